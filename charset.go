@@ -0,0 +1,57 @@
+package enmime
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// CharsetEncoder transcodes a UTF-8 string into the bytes of another MIME
+// charset, for use in an RFC 2047 encoded-word. Implementations are
+// supplied to Encoder via WithHeaderCharset.
+type CharsetEncoder interface {
+	// Name returns the MIME charset name to advertise in the encoded-word,
+	// e.g. "iso-2022-jp".
+	Name() string
+	// Encode transcodes s from UTF-8 into the target charset.
+	Encode(s string) ([]byte, error)
+}
+
+// xtextCharsetEncoder adapts a golang.org/x/text/encoding.Encoding into a
+// CharsetEncoder.
+type xtextCharsetEncoder struct {
+	name string
+	enc  *encoding.Encoder
+}
+
+func (x *xtextCharsetEncoder) Name() string { return x.name }
+
+func (x *xtextCharsetEncoder) Encode(s string) ([]byte, error) {
+	return x.enc.Bytes([]byte(s))
+}
+
+// ISO2022JPEncoder encodes header values as ISO-2022-JP, the encoded-word
+// charset most Japanese mail clients expect.
+func ISO2022JPEncoder() CharsetEncoder {
+	return &xtextCharsetEncoder{name: "iso-2022-jp", enc: japanese.ISO2022JP.NewEncoder()}
+}
+
+// ShiftJISEncoder encodes header values as Shift_JIS.
+func ShiftJISEncoder() CharsetEncoder {
+	return &xtextCharsetEncoder{name: "shift_jis", enc: japanese.ShiftJIS.NewEncoder()}
+}
+
+// EUCJPEncoder encodes header values as EUC-JP.
+func EUCJPEncoder() CharsetEncoder {
+	return &xtextCharsetEncoder{name: "euc-jp", enc: japanese.EUCJP.NewEncoder()}
+}
+
+// GB2312Encoder encodes header values as GB2312.
+//
+// x/text has no standalone GB2312 codec; GBK byte-encodes the GB2312
+// character repertoire identically to true GB2312, so it's used here instead
+// of simplifiedchinese.HZGB2312, which is the distinct 7-bit HZ mail
+// transport encoding (shift sequences, not raw GB2312 bytes).
+func GB2312Encoder() CharsetEncoder {
+	return &xtextCharsetEncoder{name: "gb2312", enc: simplifiedchinese.GBK.NewEncoder()}
+}
@@ -0,0 +1,87 @@
+package enmime
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestBuiltinCharsetEncoders(t *testing.T) {
+	for _, enc := range []CharsetEncoder{
+		ISO2022JPEncoder(),
+		ShiftJISEncoder(),
+		EUCJPEncoder(),
+		GB2312Encoder(),
+	} {
+		if enc.Name() == "" {
+			t.Errorf("%T.Name() is empty", enc)
+		}
+		if _, err := enc.Encode("hello"); err != nil {
+			t.Errorf("%T.Encode() on ASCII input: %v", enc, err)
+		}
+	}
+}
+
+func TestISO2022JPEncoderRoundTrips(t *testing.T) {
+	const s = "日本語のテスト"
+	encoded, err := ISO2022JPEncoder().Encode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := japanese.ISO2022JP.NewDecoder().Bytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != s {
+		t.Errorf("round trip = %q, want %q", decoded, s)
+	}
+}
+
+func TestShiftJISEncoderRoundTrips(t *testing.T) {
+	const s = "日本語のテスト"
+	encoded, err := ShiftJISEncoder().Encode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().Bytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != s {
+		t.Errorf("round trip = %q, want %q", decoded, s)
+	}
+}
+
+func TestEUCJPEncoderRoundTrips(t *testing.T) {
+	const s = "日本語のテスト"
+	encoded, err := EUCJPEncoder().Encode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := japanese.EUCJP.NewDecoder().Bytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != s {
+		t.Errorf("round trip = %q, want %q", decoded, s)
+	}
+}
+
+// TestGB2312EncoderRoundTrips also guards against regressing to
+// simplifiedchinese.HZGB2312, whose shift-sequence output would not decode
+// correctly as plain GBK/GB2312 bytes.
+func TestGB2312EncoderRoundTrips(t *testing.T) {
+	const s = "中文测试"
+	encoded, err := GB2312Encoder().Encode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != s {
+		t.Errorf("round trip = %q, want %q", decoded, s)
+	}
+}
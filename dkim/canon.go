@@ -0,0 +1,94 @@
+package dkim
+
+import (
+	"bytes"
+	"strings"
+)
+
+// canonicalizeBodyRelaxed implements the "relaxed" body canonicalization
+// algorithm from RFC 6376 section 3.4.4: runs of WSP within a line are
+// reduced to a single space, trailing WSP on each line is removed, and
+// trailing empty lines are removed (an entirely empty body canonicalizes to
+// the empty string, otherwise the result always ends in a single CRLF).
+func canonicalizeBodyRelaxed(body []byte) []byte {
+	lines := splitCRLFLines(body)
+	for i, line := range lines {
+		line = collapseWSP(line)
+		lines[i] = bytes.TrimRight(line, " \t")
+	}
+	lines = trimTrailingEmptyLines(lines)
+	return joinCRLFLines(lines)
+}
+
+// canonicalizeBodySimple implements the "simple" body canonicalization
+// algorithm from RFC 6376 section 3.4.3: the body is used unmodified,
+// except that trailing empty lines are removed and the result always ends
+// in a single CRLF (an empty body canonicalizes to a single CRLF).
+func canonicalizeBodySimple(body []byte) []byte {
+	lines := splitCRLFLines(body)
+	lines = trimTrailingEmptyLines(lines)
+	if len(lines) == 0 {
+		return []byte("\r\n")
+	}
+	return joinCRLFLines(lines)
+}
+
+// canonicalizeHeaderRelaxed implements the "relaxed" header canonicalization
+// algorithm from RFC 6376 section 3.4.2 for a single unfolded "name:value"
+// header line (without its trailing CRLF).
+func canonicalizeHeaderRelaxed(name, value string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	value = string(collapseWSP([]byte(value)))
+	value = strings.TrimSpace(value)
+	return name + ":" + value
+}
+
+// collapseWSP reduces every run of spaces/tabs in line to a single space.
+func collapseWSP(line []byte) []byte {
+	var out bytes.Buffer
+	inWSP := false
+	for _, b := range line {
+		if b == ' ' || b == '\t' {
+			if !inWSP {
+				out.WriteByte(' ')
+				inWSP = true
+			}
+			continue
+		}
+		inWSP = false
+		out.WriteByte(b)
+	}
+	return out.Bytes()
+}
+
+func splitCRLFLines(body []byte) [][]byte {
+	if len(body) == 0 {
+		return nil
+	}
+	norm := bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	parts := bytes.Split(norm, []byte("\n"))
+	// A trailing newline produces one spurious empty trailing element.
+	if len(parts) > 0 && len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+func trimTrailingEmptyLines(lines [][]byte) [][]byte {
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func joinCRLFLines(lines [][]byte) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	var out bytes.Buffer
+	for _, l := range lines {
+		out.Write(l)
+		out.WriteString("\r\n")
+	}
+	return out.Bytes()
+}
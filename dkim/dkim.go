@@ -0,0 +1,249 @@
+// Package dkim provides a reference EncoderMiddleware that DKIM-signs a
+// message as it is encoded by enmime.Encoder.
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Canonicalization selects the header and body canonicalization algorithms
+// used when computing a DKIM signature, each either "relaxed" or "simple"
+// per RFC 6376 section 3.4.
+type Canonicalization struct {
+	Header string
+	Body   string
+}
+
+// RelaxedSimple is the most common DKIM canonicalization choice: relaxed
+// header canonicalization, simple body canonicalization.
+var RelaxedSimple = Canonicalization{Header: "relaxed", Body: "simple"}
+
+// Middleware is a reference enmime.EncoderMiddleware that adds an
+// RSA-SHA256 DKIM-Signature header to the root Part before it is encoded.
+// It canonicalizes and signs the message by rendering it once with a plain
+// enmime.Encoder to obtain the wire bytes for hashing, then adds the
+// signature header to the same Part so the caller's real Encoder run
+// includes it.
+type Middleware struct {
+	domain        string
+	selector      string
+	key           *rsa.PrivateKey
+	headers       []string
+	canon         Canonicalization
+	renderOptions []enmime.EncoderOption
+}
+
+// NewMiddleware builds a DKIM-signing Middleware for domain/selector, using
+// key to sign and headers as the ordered list of header field names (e.g.
+// "From", "To", "Subject", "Date") to include in the signature. renderOptions
+// must match the EncoderOptions the caller's own Encoder uses, so that the
+// bytes hashed for the signature are the same bytes that are actually sent.
+func NewMiddleware(domain, selector string, key *rsa.PrivateKey, headers []string, canon Canonicalization, renderOptions ...enmime.EncoderOption) *Middleware {
+	return &Middleware{domain: domain, selector: selector, key: key, headers: headers, canon: canon, renderOptions: renderOptions}
+}
+
+// Process renders p, computes its DKIM signature, and adds a DKIM-Signature
+// header to p before returning it.
+func (m *Middleware) Process(p *enmime.Part) (*enmime.Part, error) {
+	// p may carry ContentReader bodies instead of buffered Content. Since
+	// Process's own render below is only for hashing, and the caller's real
+	// Encoder.Encode runs afterward, a streamed body must be buffered and
+	// rewound here so the real render still sees an unconsumed reader.
+	restore, err := bufferContentReaders(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	renderErr := enmime.NewEncoder(m.renderOptions...).Encode(p, &buf)
+	restore()
+	if renderErr != nil {
+		return nil, fmt.Errorf("dkim: rendering message for signing: %w", renderErr)
+	}
+	headerBytes, bodyBytes, err := splitMessage(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	var bodyCanon []byte
+	switch m.canon.Body {
+	case "relaxed":
+		bodyCanon = canonicalizeBodyRelaxed(bodyBytes)
+	default:
+		bodyCanon = canonicalizeBodySimple(bodyBytes)
+	}
+	bh := sha256.Sum256(bodyCanon)
+
+	fields := parseHeaderFields(headerBytes)
+	signedHeaders, err := selectSignedHeaders(fields, m.headers)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := time.Now().Unix()
+	sigTag := m.buildSignatureTag(signedHeaders, ts, base64.StdEncoding.EncodeToString(bh[:]), "")
+	signInput := m.canonicalizeForSigning(signedHeaders, sigTag)
+
+	digest := sha256.Sum256(signInput)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("dkim: signing: %w", err)
+	}
+	sigTag = m.buildSignatureTag(signedHeaders, ts, base64.StdEncoding.EncodeToString(bh[:]), base64.StdEncoding.EncodeToString(sig))
+
+	p.Header.Add("DKIM-Signature", " "+sigTag)
+	return p, nil
+}
+
+// bufferContentReaders reads every ContentReader in p's subtree into memory
+// and replaces it with a fresh bytes.Reader, so the tree can be rendered
+// more than once. It returns a restore func that re-seeds each affected
+// ContentReader with a new bytes.Reader over the buffered data, which must
+// be called after Process's internal render so the caller's subsequent real
+// Encoder.Encode still sees an unconsumed reader.
+func bufferContentReaders(p *enmime.Part) (restore func(), err error) {
+	parts, data, err := collectContentReaders(p)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		for i, part := range parts {
+			part.ContentReader = bytes.NewReader(data[i])
+		}
+	}, nil
+}
+
+// collectContentReaders walks p and its siblings/children, buffering each
+// ContentReader it finds, and returns the affected parts alongside their
+// buffered bytes.
+func collectContentReaders(p *enmime.Part) (parts []*enmime.Part, data [][]byte, err error) {
+	for cur := p; cur != nil; cur = cur.NextSibling {
+		if cur.ContentReader != nil {
+			buf, err := io.ReadAll(cur.ContentReader)
+			if err != nil {
+				return nil, nil, fmt.Errorf("dkim: buffering streamed part body: %w", err)
+			}
+			parts = append(parts, cur)
+			data = append(data, buf)
+			cur.ContentReader = bytes.NewReader(buf)
+		}
+		if cur.FirstChild != nil {
+			childParts, childData, err := collectContentReaders(cur.FirstChild)
+			if err != nil {
+				return nil, nil, err
+			}
+			parts = append(parts, childParts...)
+			data = append(data, childData...)
+		}
+	}
+	return parts, data, nil
+}
+
+// headerField is a single header as it appeared in the rendered message,
+// with continuation lines already unfolded into value.
+type headerField struct {
+	name  string
+	value string
+}
+
+func splitMessage(msg []byte) (header, body []byte, err error) {
+	sep := []byte("\r\n\r\n")
+	idx := bytes.Index(msg, sep)
+	if idx < 0 {
+		return nil, nil, errors.New("dkim: rendered message has no header/body separator")
+	}
+	return msg[:idx], msg[idx+len(sep):], nil
+}
+
+func parseHeaderFields(header []byte) []headerField {
+	lines := bytes.Split(header, []byte("\r\n"))
+	var fields []headerField
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			// Folded continuation of the previous header.
+			last := &fields[len(fields)-1]
+			last.value += " " + string(bytes.TrimSpace(line))
+			continue
+		}
+		parts := bytes.SplitN(line, []byte(":"), 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields = append(fields, headerField{
+			name:  string(parts[0]),
+			value: string(bytes.TrimSpace(parts[1])),
+		})
+	}
+	return fields
+}
+
+// selectSignedHeaders returns, for each requested header name, the last
+// occurrence in fields, preserving the caller's requested order as required
+// to match the h= tag. A requested header that is missing from fields is an
+// error.
+func selectSignedHeaders(fields []headerField, names []string) ([]headerField, error) {
+	var out []headerField
+	for _, name := range names {
+		found := false
+		for i := len(fields) - 1; i >= 0; i-- {
+			if strings.EqualFold(fields[i].name, name) {
+				out = append(out, fields[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("dkim: header %q to sign not present in message", name)
+		}
+	}
+	return out, nil
+}
+
+func (m *Middleware) buildSignatureTag(signedHeaders []headerField, ts int64, bh, b string) string {
+	names := make([]string, len(signedHeaders))
+	for i, f := range signedHeaders {
+		names[i] = f.name
+	}
+	return fmt.Sprintf(
+		"v=1; a=rsa-sha256; c=%s/%s; d=%s; s=%s; t=%d; h=%s; bh=%s; b=%s",
+		m.canon.Header, m.canon.Body, m.domain, m.selector,
+		ts, strings.Join(names, ":"), bh, b,
+	)
+}
+
+// canonicalizeForSigning canonicalizes the signed headers plus the
+// DKIM-Signature header itself (with an empty b= tag), in the form that is
+// hashed and RSA-signed to produce the final b= value.
+func (m *Middleware) canonicalizeForSigning(signedHeaders []headerField, sigTagWithEmptyB string) []byte {
+	var buf bytes.Buffer
+	for _, f := range signedHeaders {
+		buf.WriteString(m.canonicalizeHeaderField(f.name, f.value))
+		buf.WriteString("\r\n")
+	}
+	// The DKIM-Signature header is canonicalized like any other signed
+	// header, but without a trailing CRLF.
+	buf.WriteString(m.canonicalizeHeaderField("DKIM-Signature", sigTagWithEmptyB))
+	return buf.Bytes()
+}
+
+func (m *Middleware) canonicalizeHeaderField(name, value string) string {
+	if m.canon.Header == "relaxed" {
+		return canonicalizeHeaderRelaxed(name, value)
+	}
+	return name + ": " + value
+}
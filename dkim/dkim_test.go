@@ -0,0 +1,118 @@
+package dkim_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+
+	enmimedkim "github.com/jhillyerd/enmime/dkim"
+
+	"github.com/jhillyerd/enmime"
+)
+
+func TestMiddlewareSignatureVerifies(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := enmime.NewPart(nil, "text/plain")
+	p.Header.Set("From", "alice@example.com")
+	p.Header.Set("To", "bob@example.com")
+	p.Header.Set("Subject", "DKIM test")
+	p.Header.Set("Date", "Mon, 02 Jan 2006 15:04:05 -0700")
+	p.Content = []byte("Hello, Bob.\r\n")
+
+	mw := enmimedkim.NewMiddleware(
+		"example.com", "selector1", key,
+		[]string{"From", "To", "Subject", "Date"},
+		enmimedkim.RelaxedSimple,
+	)
+
+	enc := enmime.NewEncoder(enmime.WithMiddleware(mw))
+	var buf bytes.Buffer
+	if err := enc.Encode(p, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pubDER)
+	opts := &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{record}, nil
+		},
+	}
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("expected 1 signature, got %d", len(verifications))
+	}
+	if verifications[0].Err != nil {
+		t.Fatalf("signature did not verify: %v", verifications[0].Err)
+	}
+}
+
+func TestMiddlewareSignatureVerifiesWithStreamedBody(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := enmime.NewPart(nil, "text/plain")
+	p.Header.Set("From", "alice@example.com")
+	p.Header.Set("To", "bob@example.com")
+	p.Header.Set("Subject", "DKIM test")
+	p.Header.Set("Date", "Mon, 02 Jan 2006 15:04:05 -0700")
+	// A streaming body: Process must buffer and rewind this so the real
+	// render below still sees it intact, instead of an exhausted reader.
+	p.ContentReader = bytes.NewReader([]byte("Hello, Bob.\r\n"))
+
+	mw := enmimedkim.NewMiddleware(
+		"example.com", "selector1", key,
+		[]string{"From", "To", "Subject", "Date"},
+		enmimedkim.RelaxedSimple,
+		enmime.WithForcedTransferEncoding(enmime.TE7Bit),
+	)
+
+	enc := enmime.NewEncoder(enmime.WithMiddleware(mw), enmime.WithForcedTransferEncoding(enmime.TE7Bit))
+	var buf bytes.Buffer
+	if err := enc.Encode(p, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("Hello, Bob.")) {
+		t.Fatalf("rendered message lost its streamed body: %q", buf.Bytes())
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pubDER)
+	opts := &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{record}, nil
+		},
+	}
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verifications) != 1 {
+		t.Fatalf("expected 1 signature, got %d", len(verifications))
+	}
+	if verifications[0].Err != nil {
+		t.Fatalf("signature did not verify: %v", verifications[0].Err)
+	}
+}
@@ -2,6 +2,8 @@ package enmime
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/x509"
 	"encoding/base64"
 	"io"
 	"mime"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/jhillyerd/enmime/internal/coding"
 	"github.com/jhillyerd/enmime/internal/stringutil"
+	"github.com/jhillyerd/enmime/smime"
 )
 
 // b64Percent determines the percent of non-ASCII characters enmime will tolerate before switching
@@ -36,11 +39,55 @@ type Encoder struct {
 	contentTypeDeterminer      func(*Part) bool
 	boundaryGenerator          func() string
 	headerEncoderFactory       HeaderEncoderFactory
+	smimeSigner                *smime.Signer
+	smimeRecipients            []*x509.Certificate
+	forcedTransferEncoding     *TransferEncoding
+	headerCharsetSelector      HeaderCharsetSelector
+	middleware                 []EncoderMiddleware
+	preserveOriginal           bool
+}
+
+// WithPreserveOriginal controls whether Encoder re-emits a Part's original
+// source bytes verbatim instead of re-encoding it. It only has an effect on
+// Parts captured by a parser that populated Part.RawHeader/Part.RawContent;
+// a Part is re-encoded as usual whenever it has no raw capture, or whenever
+// Part.Dirty is true because something mutated it after parsing.
+func WithPreserveOriginal(preserve bool) EncoderOption {
+	return func(e *Encoder) *Encoder {
+		e.preserveOriginal = preserve
+		return e
+	}
+}
+
+// EncoderMiddleware transforms the root Part before Encoder encodes it,
+// letting callers bolt on cross-cutting concerns such as PGP/MIME
+// encryption or DKIM signing without forking Encode. Middlewares run in the
+// order they were passed to WithMiddleware, before setupMIMEHeaders.
+type EncoderMiddleware interface {
+	Process(p *Part) (*Part, error)
+}
+
+// WithMiddleware registers one or more EncoderMiddleware to run, in order,
+// on the root Part before it is encoded.
+func WithMiddleware(mw ...EncoderMiddleware) EncoderOption {
+	return func(e *Encoder) *Encoder {
+		e.middleware = append(e.middleware, mw...)
+		return e
+	}
 }
 
 // setupMIMEHeaders determines content transfer encoding, generates a boundary string if required,
 // then sets the Content-Type (type, charset, filename, boundary) and Content-Disposition headers.
 func (e *Encoder) setupMIMEHeaders(p *Part) TransferEncoding {
+	// If preservation is on and this part still has its original Content-Transfer-Encoding
+	// available, keep it rather than re-deriving it below. A Dirty part's
+	// content/type may no longer match what was captured, so it must always
+	// be re-derived instead.
+	preservedCTE := ""
+	if e.preserveOriginal && !p.Dirty && p.RawHeader != nil {
+		preservedCTE = p.RawHeader.Get(hnContentEncoding)
+	}
+
 	// Determine content transfer encoding.
 
 	// If we are encoding a part that previously had content-transfer-encoding set, unset it so
@@ -48,10 +95,20 @@ func (e *Encoder) setupMIMEHeaders(p *Part) TransferEncoding {
 	p.Header.Del(hnContentEncoding)
 
 	cte := TE7Bit
-	if len(p.Content) > 0 {
+	if preservedCTE != "" {
+		p.Header.Set(hnContentEncoding, preservedCTE)
+		cte = cteFromHeaderValue(preservedCTE)
+	} else if len(p.Content) > 0 || p.ContentReader != nil {
 		cte = TEBase64
 		if e.contentTypeDeterminer(p) {
-			cte = e.transferEncodingDeterminer(p.Content, false)
+			switch {
+			case e.forcedTransferEncoding != nil:
+				// Caller knows best, e.g. because only a ContentReader is available and
+				// p.Content can't be sniffed.
+				cte = *e.forcedTransferEncoding
+			case len(p.Content) > 0:
+				cte = e.transferEncodingDeterminer(p.Content, false)
+			}
 			if p.Charset == "" {
 				p.Charset = utf8
 			}
@@ -73,36 +130,113 @@ func (e *Encoder) setupMIMEHeaders(p *Part) TransferEncoding {
 		p.Header.Set(hnContentID, coding.ToIDHeader(p.ContentID))
 	}
 	if p.ContentType != "" {
-		// Build content type header.
-		param := make(map[string]string)
-		setParamValue(param, hpCharset, p.Charset)
-		setParamValue(param, hpName, stringutil.ToASCII(p.FileName))
-		setParamValue(param, hpBoundary, p.Boundary)
-		mt := mime.FormatMediaType(p.ContentType, param)
-		if mt == "" {
-			// There was an error, FormatMediaType couldn't encode the params.
-			mt = p.ContentType
+		if raw := e.rawHeaderIfPreserving(p, hnContentType); raw != "" {
+			p.Header.Set(hnContentType, raw)
+		} else {
+			// Build content type header.
+			param := make(map[string]string)
+			setParamValue(param, hpCharset, p.Charset)
+			setParamValue(param, hpName, stringutil.ToASCII(p.FileName))
+			setParamValue(param, hpBoundary, p.Boundary)
+			mt := mime.FormatMediaType(p.ContentType, param)
+			if mt == "" {
+				// There was an error, FormatMediaType couldn't encode the params.
+				mt = p.ContentType
+			}
+			p.Header.Set(hnContentType, mt)
 		}
-		p.Header.Set(hnContentType, mt)
 	}
 	if p.Disposition != "" {
-		// Build disposition header.
-		param := make(map[string]string)
-		setParamValue(param, hpFilename, stringutil.ToASCII(p.FileName))
-		if !p.FileModDate.IsZero() {
-			setParamValue(param, hpModDate, p.FileModDate.Format(time.RFC822))
-		}
-		mt := mime.FormatMediaType(p.Disposition, param)
-		if mt == "" {
-			// There was an error, FormatMediaType couldn't encode the params.
-			mt = p.Disposition
+		if raw := e.rawHeaderIfPreserving(p, hnContentDisposition); raw != "" {
+			p.Header.Set(hnContentDisposition, raw)
+		} else {
+			// Build disposition header.
+			param := make(map[string]string)
+			setParamValue(param, hpFilename, stringutil.ToASCII(p.FileName))
+			if !p.FileModDate.IsZero() {
+				setParamValue(param, hpModDate, p.FileModDate.Format(time.RFC822))
+			}
+			mt := mime.FormatMediaType(p.Disposition, param)
+			if mt == "" {
+				// There was an error, FormatMediaType couldn't encode the params.
+				mt = p.Disposition
+			}
+			p.Header.Set(hnContentDisposition, mt)
 		}
-		p.Header.Set(hnContentDisposition, mt)
 	}
 	return cte
 }
 
+// rawHeaderIfPreserving returns p's original, unmodified value for name if
+// WithPreserveOriginal is on, p is not Dirty, and p.RawHeader captured one,
+// so callers can reuse the source formatting (parameter order, quoting)
+// instead of re-deriving it with mime.FormatMediaType. A Dirty part must
+// always have this header re-derived, since its captured raw value may no
+// longer describe the part's current content/type.
+func (e *Encoder) rawHeaderIfPreserving(p *Part, name string) string {
+	if !e.preserveOriginal || p.Dirty || p.RawHeader == nil {
+		return ""
+	}
+	return p.RawHeader.Get(name)
+}
+
+// cteFromHeaderValue maps a Content-Transfer-Encoding header value back to
+// a TransferEncoding, for reuse when preserving a part's original encoding.
+func cteFromHeaderValue(v string) TransferEncoding {
+	switch v {
+	case cteBase64:
+		return TEBase64
+	case cteQuotedPrintable:
+		return TEQuoted
+	default:
+		return TE7Bit
+	}
+}
+
 func (e *Encoder) Encode(p *Part, writer io.Writer) error {
+	for _, mw := range e.middleware {
+		var err error
+		if p, err = mw.Process(p); err != nil {
+			return err
+		}
+	}
+	if e.smimeSigner == nil && len(e.smimeRecipients) == 0 {
+		return e.encode(p, writer)
+	}
+	// S/MIME signing and/or enveloping requires the canonical CRLF form of
+	// the root part up front, so render it to a buffer before wrapping.
+	buf := &bytes.Buffer{}
+	if err := e.encode(p, buf); err != nil {
+		return err
+	}
+	out := buf.Bytes()
+	if e.smimeSigner != nil {
+		signed, err := e.smimeSign(out)
+		if err != nil {
+			return err
+		}
+		out = signed
+	}
+	if len(e.smimeRecipients) > 0 {
+		enveloped, err := e.smimeEnvelope(out)
+		if err != nil {
+			return err
+		}
+		out = enveloped
+	}
+	_, err := writer.Write(out)
+	return err
+}
+
+// encode renders p and its children in plain MIME form, without any S/MIME
+// signing or enveloping.
+func (e *Encoder) encode(p *Part, writer io.Writer) error {
+	if e.preserveOriginal && !p.Dirty && p.RawContent != nil {
+		// Untouched subtree: re-emit the bytes the parser captured, rather than
+		// rebuilding headers/boundaries/CTE that may not round-trip exactly.
+		_, err := writer.Write(p.RawContent)
+		return err
+	}
 	if p.Header == nil {
 		p.Header = make(textproto.MIMEHeader)
 	}
@@ -112,7 +246,7 @@ func (e *Encoder) Encode(p *Part, writer io.Writer) error {
 	if err := e.encodeHeader(p, b); err != nil {
 		return err
 	}
-	if len(p.Content) > 0 {
+	if len(p.Content) > 0 || p.ContentReader != nil {
 		b.Write(crnl)
 		if err := e.encodeContent(p, b, cte); err != nil {
 			return err
@@ -121,14 +255,15 @@ func (e *Encoder) Encode(p *Part, writer io.Writer) error {
 	if p.FirstChild == nil {
 		return b.Flush()
 	}
-	// Encode children.
+	// Encode children. Recurse through e, not Part.Encode/DefaultEncoder, so
+	// options like WithPreserveOriginal apply to the whole subtree.
 	endMarker := []byte("\r\n--" + p.Boundary + "--")
 	marker := endMarker[:len(endMarker)-2]
 	c := p.FirstChild
 	for c != nil {
 		b.Write(marker)
 		b.Write(crnl)
-		if err := c.Encode(b); err != nil {
+		if err := e.encode(c, b); err != nil {
 			return err
 		}
 		c = c.NextSibling
@@ -138,6 +273,62 @@ func (e *Encoder) Encode(p *Part, writer io.Writer) error {
 	return b.Flush()
 }
 
+// smimeSign wraps body in a multipart/signed envelope, with body as the
+// first part and a detached PKCS#7 SignedData signature as the second.
+func (e *Encoder) smimeSign(body []byte) ([]byte, error) {
+	sig, err := e.smimeSigner.Sign(body)
+	if err != nil {
+		return nil, err
+	}
+	boundary := e.boundaryGenerator()
+	buf := &bytes.Buffer{}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: multipart/signed; protocol=\"application/pkcs7-signature\";\r\n")
+	buf.WriteString("\tmicalg=sha-256; boundary=\"" + boundary + "\"\r\n")
+	buf.WriteString("\r\n--" + boundary + "\r\n")
+	buf.Write(body)
+	buf.WriteString("\r\n--" + boundary + "\r\n")
+	buf.WriteString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	writeBase64Wrapped(buf, sig)
+	buf.WriteString("\r\n--" + boundary + "--\r\n")
+	return buf.Bytes(), nil
+}
+
+// smimeEnvelope CMS-encrypts body for e.smimeRecipients, replacing it with
+// a base64-wrapped application/pkcs7-mime message.
+func (e *Encoder) smimeEnvelope(body []byte) ([]byte, error) {
+	enveloped, err := smime.Envelope(body, e.smimeRecipients)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+	writeBase64Wrapped(buf, enveloped)
+	return buf.Bytes(), nil
+}
+
+// writeBase64Wrapped base64-encodes data and wraps it at 76 columns.
+func writeBase64Wrapped(buf *bytes.Buffer, data []byte) {
+	enc := base64.StdEncoding
+	text := make([]byte, enc.EncodedLen(len(data)))
+	enc.Encode(text, data)
+	lineLen := 76
+	for len(text) > 0 {
+		n := lineLen
+		if n > len(text) {
+			n = len(text)
+		}
+		buf.Write(text[:n])
+		buf.Write(crnl)
+		text = text[n:]
+	}
+}
+
 // encodeHeader writes out a sorted list of headers.
 func (e *Encoder) encodeHeader(p *Part, b *bufio.Writer) error {
 	keys := make([]string, 0, len(p.Header))
@@ -150,15 +341,27 @@ func (e *Encoder) encodeHeader(p *Part, b *bufio.Writer) error {
 		return err
 	}
 	for _, k := range keys {
+		if hna, ok := headerEncoder.(headerNameAware); ok {
+			hna.SetHeaderName(k)
+		}
 		for _, v := range p.Header[k] {
-			// TODO: headerEncoder is expected to fold it. Should fix this later.
-			_, encv, err := headerEncoder.Encode(0, v)
+			startColumn := len(k) + 2 // "Name: "
+			_, encv, err := headerEncoder.Encode(startColumn, v)
 			if err != nil {
 				return err
 			}
-			// _ used to prevent early wrapping
-			wb := stringutil.Wrap(76, k, ":_", encv, "\r\n")
-			wb[len(k)+1] = ' '
+			var wb []byte
+			if fa, ok := headerEncoder.(foldAwareHeaderEncoder); ok && fa.LastEncodeWasFolded() {
+				// encv is one or more RFC 2047 encoded-words, already folded by the
+				// header encoder with CRLF+space between words; stringutil.Wrap's
+				// whitespace folding would split a word or insert an illegal fold
+				// inside one, so write it as-is.
+				wb = []byte(k + ": " + encv + "\r\n")
+			} else {
+				// _ used to prevent early wrapping
+				wb = stringutil.Wrap(76, k, ":_", encv, "\r\n")
+				wb[len(k)+1] = ' '
+			}
 			if _, err := b.Write(wb); err != nil {
 				return err
 			}
@@ -169,6 +372,9 @@ func (e *Encoder) encodeHeader(p *Part, b *bufio.Writer) error {
 
 // encodeContent writes out the content in the selected encoding.
 func (e *Encoder) encodeContent(p *Part, b *bufio.Writer, cte TransferEncoding) (err error) {
+	if p.ContentReader != nil {
+		return e.encodeContentReader(p.ContentReader, b, cte)
+	}
 	switch cte {
 	case TEBase64:
 		enc := base64.StdEncoding
@@ -198,6 +404,73 @@ func (e *Encoder) encodeContent(p *Part, b *bufio.Writer, cte TransferEncoding)
 	return err
 }
 
+// encodeContentReader streams src through the selected transfer encoding
+// without materialising the whole body in memory, for Parts whose content
+// is supplied via ContentReader instead of Content.
+func (e *Encoder) encodeContentReader(src io.Reader, b *bufio.Writer, cte TransferEncoding) (err error) {
+	switch cte {
+	case TEBase64:
+		lw := &lineWrapWriter{w: b, width: 76}
+		enc := base64.NewEncoder(base64.StdEncoding, lw)
+		if _, err = io.Copy(enc, src); err != nil {
+			return err
+		}
+		if err = enc.Close(); err != nil {
+			return err
+		}
+		return lw.Close()
+	case TEQuoted:
+		qp := quotedprintable.NewWriter(b)
+		if _, err = io.Copy(qp, src); err != nil {
+			return err
+		}
+		err = qp.Close()
+	default:
+		_, err = io.Copy(b, src)
+	}
+	return err
+}
+
+// lineWrapWriter inserts a CRLF after every width bytes written, matching
+// the line length used by encodeContent's in-memory base64 path.
+type lineWrapWriter struct {
+	w     io.Writer
+	width int
+	col   int
+}
+
+func (l *lineWrapWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := l.width - l.col
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		l.col += n
+		p = p[n:]
+		if l.col == l.width {
+			if _, err := l.w.Write(crnl); err != nil {
+				return written, err
+			}
+			l.col = 0
+		}
+	}
+	return written, nil
+}
+
+// Close flushes a trailing partial line, if any.
+func (l *lineWrapWriter) Close() error {
+	if l.col > 0 {
+		_, err := l.w.Write(crnl)
+		return err
+	}
+	return nil
+}
+
 // SelectTransferEncoding scans content for non-ASCII characters and selects 'b' or 'q' encoding.
 func SelectTransferEncoding(content []byte, quoteLineBreaks bool) TransferEncoding {
 	if len(content) == 0 {
@@ -253,28 +526,142 @@ func WithHeaderEncoderFactory(f HeaderEncoderFactory) EncoderOption {
 	}
 }
 
+// WithForcedTransferEncoding bypasses Encoder's usual content sniffing and
+// uses cte for text parts with content (those the content type determiner
+// accepts); other parts with content are still base64-encoded. Without it, a
+// text Part that supplies its body via ContentReader rather than Content is
+// base64-encoded, since the sniffing in SelectTransferEncoding needs the
+// whole body in memory.
+func WithForcedTransferEncoding(cte TransferEncoding) EncoderOption {
+	return func(e *Encoder) *Encoder {
+		e.forcedTransferEncoding = &cte
+		return e
+	}
+}
+
+// WithSMIMESigner configures the Encoder to wrap its output in a
+// multipart/signed envelope, detached-signed with signer, using PKCS#7
+// SignedData.
+func WithSMIMESigner(signer *smime.Signer) EncoderOption {
+	return func(e *Encoder) *Encoder {
+		e.smimeSigner = signer
+		return e
+	}
+}
+
+// WithSMIMERecipients configures the Encoder to CMS-envelope its output for
+// the given recipient certificates, producing an
+// application/pkcs7-mime; smime-type=enveloped-data message. If
+// WithSMIMESigner is also set, the message is signed before it is
+// enveloped.
+func WithSMIMERecipients(certs []*x509.Certificate) EncoderOption {
+	return func(e *Encoder) *Encoder {
+		e.smimeRecipients = certs
+		return e
+	}
+}
+
+// HeaderCharsetSelector picks the CharsetEncoder to use when encoding
+// headerName on p, or returns nil to fall back to p.Charset (UTF-8 by
+// default).
+type HeaderCharsetSelector func(p *Part, headerName string) CharsetEncoder
+
+// WithHeaderCharset lets callers choose a legacy charset, such as
+// ISO-2022-JP or GB2312, for RFC 2047 encoded-words on a per-part,
+// per-header basis. sel is consulted for every header value encoded by
+// flexibleHeaderEncoder, including the display names joined by
+// stringutil.EncodeAwareJoinAddress.
+func WithHeaderCharset(sel HeaderCharsetSelector) EncoderOption {
+	return func(e *Encoder) *Encoder {
+		e.headerCharsetSelector = sel
+		return e
+	}
+}
+
+// headerNameAware lets encodeHeader tell a HeaderEncoder which header it is
+// about to encode values for, so per-header charset selection is possible
+// without changing the HeaderEncoder interface itself.
+type headerNameAware interface {
+	SetHeaderName(name string)
+}
+
+// foldAwareHeaderEncoder lets encodeHeader ask a HeaderEncoder whether its
+// last Encode call produced already-folded RFC 2047 encoded-words, so it can
+// skip stringutil.Wrap's own folding rather than guessing from the value's
+// contents (a plain header value can legitimately contain the literal
+// substring "=?").
+type foldAwareHeaderEncoder interface {
+	LastEncodeWasFolded() bool
+}
+
 type flexibleHeaderEncoder struct {
 	*Encoder
-	p *Part
+	p          *Part
+	headerName string
+	lastFolded bool
+}
+
+func (e *flexibleHeaderEncoder) SetHeaderName(name string) {
+	e.headerName = name
+}
+
+// LastEncodeWasFolded reports whether the most recent Encode call returned
+// one or more RFC 2047 encoded-words, already folded by FoldEncodedWords,
+// rather than a plain unencoded value. encodeHeader uses this to decide
+// whether stringutil.Wrap's own whitespace folding is safe to apply.
+func (e *flexibleHeaderEncoder) LastEncodeWasFolded() bool {
+	return e.lastFolded
 }
 
 func (e *flexibleHeaderEncoder) Encode(startColumn int, v string) (int, string, error) {
+	if e.headerCharsetSelector != nil {
+		if cs := e.headerCharsetSelector(e.p, e.headerName); cs != nil {
+			return e.encodeWithCharset(startColumn, v, cs)
+		}
+	}
 	cs := e.p.Charset
 	if cs == "" {
 		cs = utf8
 	}
 	switch e.transferEncodingDeterminer([]byte(v), true) {
 	case TEBase64:
-		v = mime.BEncoding.Encode(cs, v)
+		e.lastFolded = true
+		return e.encodeRFC2047(startColumn, v, cs, identityTranscode, true)
 	case TEQuoted:
-		v = mime.QEncoding.Encode(cs, v)
+		e.lastFolded = true
+		return e.encodeRFC2047(startColumn, v, cs, identityTranscode, false)
 	default:
+		e.lastFolded = false
+		return startColumn + len(v), v, nil
+	}
+}
+
+// encodeWithCharset renders v as one or more RFC 2047 encoded-words using
+// cs instead of the Part's own charset.
+func (e *flexibleHeaderEncoder) encodeWithCharset(startColumn int, v string, cs CharsetEncoder) (int, string, error) {
+	useB := e.transferEncodingDeterminer([]byte(v), true) == TEBase64
+	e.lastFolded = true
+	return e.encodeRFC2047(startColumn, v, cs.Name(), cs.Encode, useB)
+}
+
+// identityTranscode is used when the header's own UTF-8 value needs no
+// transcoding before it's split into encoded-words.
+func identityTranscode(s string) ([]byte, error) { return []byte(s), nil }
+
+// encodeRFC2047 splits v into correctly folded RFC 2047 encoded-words.
+func (e *flexibleHeaderEncoder) encodeRFC2047(
+	startColumn int, v, charset string, transcode func(string) ([]byte, error), useB bool,
+) (int, string, error) {
+	words, err := coding.SplitEncodedWords(charset, v, transcode, useB)
+	if err != nil {
+		return startColumn, "", err
 	}
-	return startColumn + len(v), v, nil
+	folded := coding.FoldEncodedWords(words, startColumn)
+	return startColumn + len(folded), folded, nil
 }
 
 func newFlexibleHeaderEncoder(e *Encoder, p *Part) (HeaderEncoder, error) {
-	return &flexibleHeaderEncoder{e, p}, nil
+	return &flexibleHeaderEncoder{Encoder: e, p: p}, nil
 }
 
 func NewEncoder(options ...EncoderOption) *Encoder {
@@ -2,10 +2,21 @@ package enmime_test
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/textproto"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jhillyerd/enmime"
 	"github.com/jhillyerd/enmime/internal/test"
+	"github.com/jhillyerd/enmime/smime"
+	"go.mozilla.org/pkcs7"
 )
 
 func TestEncodePartEmpty(t *testing.T) {
@@ -74,6 +85,290 @@ func TestEncodePartBinaryHeader(t *testing.T) {
 	test.DiffGolden(t, b.Bytes(), "testdata", "encode", "part-bin-header.golden")
 }
 
+func TestEncodePartStreamedContent(t *testing.T) {
+	p := enmime.NewPart(nil, "text/plain")
+	p.ContentReader = bytes.NewReader([]byte("This is a test of a plain text part.\r\n\r\nAnother line.\r\n"))
+
+	b := &bytes.Buffer{}
+	enc := enmime.NewEncoder(enmime.WithForcedTransferEncoding(enmime.TE7Bit))
+	err := enc.Encode(p, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.DiffGolden(t, b.Bytes(), "testdata", "encode", "part-plain.golden")
+}
+
+func TestEncodePartStreamedContentBase64MatchesBuffered(t *testing.T) {
+	content := []byte(strings.Repeat("Non-ASCII streamed test: héllo, wörld! ", 10))
+
+	buffered := enmime.NewPart(nil, "text/plain")
+	buffered.Content = content
+	bufBuf := &bytes.Buffer{}
+	bufEnc := enmime.NewEncoder(enmime.WithForcedTransferEncoding(enmime.TEBase64))
+	if err := bufEnc.Encode(buffered, bufBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	streamed := enmime.NewPart(nil, "text/plain")
+	streamed.ContentReader = bytes.NewReader(content)
+	streamedBuf := &bytes.Buffer{}
+	streamedEnc := enmime.NewEncoder(enmime.WithForcedTransferEncoding(enmime.TEBase64))
+	if err := streamedEnc.Encode(streamed, streamedBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(streamedBuf.Bytes(), bufBuf.Bytes()) {
+		t.Errorf("streamed TEBase64 output differs from buffered:\nstreamed: %q\nbuffered: %q",
+			streamedBuf.Bytes(), bufBuf.Bytes())
+	}
+}
+
+func TestEncodePartStreamedContentQuotedPrintableMatchesBuffered(t *testing.T) {
+	content := []byte(strings.Repeat("Non-ASCII streamed test: héllo, wörld! ", 10))
+
+	buffered := enmime.NewPart(nil, "text/plain")
+	buffered.Content = content
+	bufBuf := &bytes.Buffer{}
+	bufEnc := enmime.NewEncoder(enmime.WithForcedTransferEncoding(enmime.TEQuoted))
+	if err := bufEnc.Encode(buffered, bufBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	streamed := enmime.NewPart(nil, "text/plain")
+	streamed.ContentReader = bytes.NewReader(content)
+	streamedBuf := &bytes.Buffer{}
+	streamedEnc := enmime.NewEncoder(enmime.WithForcedTransferEncoding(enmime.TEQuoted))
+	if err := streamedEnc.Encode(streamed, streamedBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(streamedBuf.Bytes(), bufBuf.Bytes()) {
+		t.Errorf("streamed TEQuoted output differs from buffered:\nstreamed: %q\nbuffered: %q",
+			streamedBuf.Bytes(), bufBuf.Bytes())
+	}
+}
+
+func TestEncodePartPreserveOriginalUntouched(t *testing.T) {
+	original := []byte("Content-Type: text/plain; charset=us-ascii\r\n" +
+		"X-Custom:    oddly   spaced\r\n\r\n" +
+		"Original body, never re-derived.\r\n")
+
+	p := enmime.NewPart(nil, "text/plain")
+	p.RawContent = original
+	// Content intentionally differs from RawContent to prove the raw bytes,
+	// not Content, are what gets emitted when the part isn't Dirty.
+	p.Content = []byte("this must not appear in the output")
+
+	b := &bytes.Buffer{}
+	enc := enmime.NewEncoder(enmime.WithPreserveOriginal(true))
+	if err := enc.Encode(p, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), original) {
+		t.Errorf("Encode() with unmodified RawContent = %q, want %q", b.Bytes(), original)
+	}
+}
+
+func TestEncodePartPreserveOriginalDirty(t *testing.T) {
+	p := enmime.NewPart(nil, "text/plain")
+	p.RawContent = []byte("Content-Type: text/plain\r\n\r\nstale body\r\n")
+	p.Content = []byte("This is a test of a plain text part.\r\n\r\nAnother line.\r\n")
+	p.Dirty = true
+
+	b := &bytes.Buffer{}
+	enc := enmime.NewEncoder(enmime.WithPreserveOriginal(true))
+	if err := enc.Encode(p, b); err != nil {
+		t.Fatal(err)
+	}
+	test.DiffGolden(t, b.Bytes(), "testdata", "encode", "part-plain.golden")
+}
+
+func TestEncodePartPreserveOriginalDirtyIgnoresRawHeader(t *testing.T) {
+	p := enmime.NewPart(nil, "text/plain")
+	p.RawHeader = textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=us-ascii"},
+		"Content-Transfer-Encoding": {"7bit"},
+	}
+	p.RawContent = []byte("Content-Type: text/plain; charset=us-ascii\r\n" +
+		"Content-Transfer-Encoding: 7bit\r\n\r\nstale ascii body\r\n")
+	// Non-ASCII content that no longer matches the captured raw 7bit CTE or
+	// us-ascii charset; being Dirty must force both to be re-derived instead
+	// of blindly reusing the stale RawHeader values.
+	p.Content = []byte("Non-ASCII: héllo\r\n")
+	p.Dirty = true
+
+	b := &bytes.Buffer{}
+	enc := enmime.NewEncoder(enmime.WithPreserveOriginal(true))
+	if err := enc.Encode(p, b); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.String()
+	if strings.Contains(out, "Content-Transfer-Encoding: 7bit") {
+		t.Errorf("Encode() reused stale 7bit CTE for Dirty non-ASCII content: %q", out)
+	}
+	if strings.Contains(out, "charset=us-ascii") {
+		t.Errorf("Encode() reused stale us-ascii Content-Type for Dirty content: %q", out)
+	}
+}
+
+func TestEncodeHeaderFoldsLongEncodedWord(t *testing.T) {
+	p := enmime.NewPart(nil, "text/plain")
+	// Long enough that a single =?utf-8?B?...?= blob would badly exceed 75
+	// chars; must come out as several properly folded encoded-words instead.
+	p.Header.Set("Subject", strings.Repeat("日本語のテスト ", 20))
+
+	b := &bytes.Buffer{}
+	if err := p.Encode(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var words []string
+	for _, line := range strings.Split(b.String(), "\r\n") {
+		line = strings.TrimPrefix(strings.TrimPrefix(line, "Subject:"), " ")
+		if strings.HasPrefix(line, "=?utf-8?B?") {
+			words = append(words, line)
+		}
+	}
+	if len(words) < 2 {
+		t.Fatalf("expected the long Subject to fold into multiple encoded-words, got: %v", words)
+	}
+	for _, word := range words {
+		if len(word) > 75 {
+			t.Errorf("encoded-word exceeds 75 chars: %q (%d)", word, len(word))
+		}
+		if !strings.HasSuffix(word, "?=") {
+			t.Errorf("malformed encoded-word: %q", word)
+		}
+	}
+}
+
+// genRSACertForTest builds a throwaway self-signed RSA certificate, suitable
+// for both S/MIME signing and enveloping.
+func genRSACertForTest(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "enmime test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestEncodePartSMIMESignedAndEnveloped(t *testing.T) {
+	cert, key := genRSACertForTest(t)
+	signer := smime.NewSigner(cert, key, nil)
+
+	p := enmime.NewPart(nil, "text/plain")
+	p.Content = []byte("This is a test of a plain text part.\r\n\r\nAnother line.\r\n")
+
+	b := &bytes.Buffer{}
+	enc := enmime.NewEncoder(
+		enmime.WithSMIMESigner(signer),
+		enmime.WithSMIMERecipients([]*x509.Certificate{cert}),
+	)
+	if err := enc.Encode(p, b); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.Bytes()
+	if !bytes.Contains(out, []byte("MIME-Version: 1.0\r\n")) {
+		t.Errorf("Encode() output missing MIME-Version header: %q", out)
+	}
+	if !bytes.Contains(out, []byte("application/pkcs7-mime")) {
+		t.Errorf("Encode() output not enveloped: %q", out)
+	}
+
+	i := bytes.Index(out, []byte("\r\n\r\n"))
+	if i < 0 {
+		t.Fatalf("no header/body separator found in %q", out)
+	}
+	var payload string
+	for _, line := range strings.Split(string(out[i+4:]), "\r\n") {
+		payload += line
+	}
+	enveloped, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope, err := pkcs7.Parse(enveloped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBytes, err := envelope.Decrypt(cert, key)
+	if err != nil {
+		t.Fatalf("failed to decrypt envelope: %v", err)
+	}
+
+	// The decrypted payload is the multipart/signed message: the signed body is
+	// its first part and the base64 detached signature is its second.
+	signedMsg := string(signedBytes)
+	const boundaryParam = "boundary=\""
+	bi := strings.Index(signedMsg, boundaryParam)
+	if bi < 0 {
+		t.Fatalf("decrypted payload is not multipart/signed: %q", signedMsg)
+	}
+	boundary := signedMsg[bi+len(boundaryParam):]
+	boundary = boundary[:strings.Index(boundary, "\"")]
+	sections := strings.Split(
+		strings.TrimSuffix(signedMsg, "\r\n--"+boundary+"--\r\n"), "\r\n--"+boundary+"\r\n")
+	if len(sections) != 3 {
+		t.Fatalf("multipart/signed payload has %d sections, want 3: %q", len(sections), signedMsg)
+	}
+	signedBody := []byte(sections[1])
+	si := strings.Index(sections[2], "\r\n\r\n")
+	if si < 0 {
+		t.Fatalf("signature part has no header/body separator: %q", sections[2])
+	}
+	sigDER, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(sections[2][si+4:], "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := pkcs7.Parse(sigDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.Content = signedBody
+	if err := signed.Verify(); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	if !bytes.Contains(signedBody, []byte("This is a test of a plain text part.")) {
+		t.Errorf("signed content = %q, want it to contain the original body", signedBody)
+	}
+}
+
+func TestEncodeHeaderDoesNotMistakeLiteralEqualsQuestionForEncodedWord(t *testing.T) {
+	p := enmime.NewPart(nil, "text/plain")
+	// A plain ASCII value containing the literal substring "=?" must not be
+	// mistaken for an already-folded RFC 2047 encoded-word; it should still
+	// go through stringutil.Wrap like any other plain header value.
+	p.Header.Set("X-Query", "a=?b=?c")
+
+	b := &bytes.Buffer{}
+	if err := p.Encode(b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "X-Query: a=?b=?c\r\n") {
+		t.Errorf("Encode() mangled a plain value containing a literal \"=?\": %q", b.String())
+	}
+}
+
 func TestEncodePartWithChildren(t *testing.T) {
 	p := enmime.NewPart(nil, "multipart/alternative")
 	p.Boundary = "enmime-1234567890-parent"
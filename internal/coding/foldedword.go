@@ -0,0 +1,109 @@
+package coding
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// maxEncodedWordLen is the longest an RFC 2047 encoded-word, including its
+// "=?charset?B?...?=" or "=?charset?Q?...?=" framing, may be.
+const maxEncodedWordLen = 75
+
+// SplitEncodedWords splits s into one or more RFC 2047 encoded-words no
+// longer than maxEncodedWordLen, using charset as the encoded-word's
+// charset name. transcode converts a substring of s from UTF-8 into that
+// charset; it is only ever called with whole-rune prefixes of the part of s
+// not yet encoded, so a multibyte source rune is never split across two
+// words. useB selects
+// base64 ("B") encoding over the RFC 2047 "Q" encoding.
+func SplitEncodedWords(charset string, s string, transcode func(string) ([]byte, error), useB bool) ([]string, error) {
+	runes := []rune(s)
+	var words []string
+	for len(runes) > 0 {
+		// Binary search the longest rune-prefix whose encoded-word still fits.
+		lo, hi := 1, len(runes)
+		best := 0
+		bestWord := ""
+		for lo <= hi {
+			mid := lo + (hi-lo)/2
+			word, err := encodeWord(charset, string(runes[:mid]), transcode, useB)
+			if err != nil {
+				return nil, err
+			}
+			if len(word) <= maxEncodedWordLen {
+				best, bestWord = mid, word
+				lo = mid + 1
+			} else {
+				hi = mid - 1
+			}
+		}
+		if best == 0 {
+			// A single rune doesn't fit in maxEncodedWordLen; emit it anyway
+			// rather than loop forever or drop data.
+			word, err := encodeWord(charset, string(runes[0]), transcode, useB)
+			if err != nil {
+				return nil, err
+			}
+			best, bestWord = 1, word
+		}
+		words = append(words, bestWord)
+		runes = runes[best:]
+	}
+	return words, nil
+}
+
+// FoldEncodedWords joins words, as produced by SplitEncodedWords, into a
+// single header value using RFC 2047/2822 folding: words are separated by
+// "\r\n " (a CRLF plus one folding space), and if the first word would not
+// fit on the current line after startColumn, a fold is inserted before it
+// too.
+func FoldEncodedWords(words []string, startColumn int) string {
+	if len(words) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	if startColumn+len(words[0]) > 76 {
+		sb.WriteString("\r\n ")
+	}
+	sb.WriteString(words[0])
+	for _, w := range words[1:] {
+		sb.WriteString("\r\n ")
+		sb.WriteString(w)
+	}
+	return sb.String()
+}
+
+func encodeWord(charset, s string, transcode func(string) ([]byte, error), useB bool) (string, error) {
+	transcoded, err := transcode(s)
+	if err != nil {
+		return "", err
+	}
+	var body string
+	letter := "Q"
+	if useB {
+		letter = "B"
+		body = base64.StdEncoding.EncodeToString(transcoded)
+	} else {
+		body = qEncode(transcoded)
+	}
+	return "=?" + charset + "?" + letter + "?" + body + "?=", nil
+}
+
+// qEncode implements RFC 2047 Q-encoding, which differs from
+// quoted-printable in that a space is represented by '_' rather than "=20".
+func qEncode(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch {
+		case c == ' ':
+			sb.WriteByte('_')
+		case c == '_' || c == '=' || c == '?' || c < 0x20 || c >= 0x7f:
+			sb.WriteByte('=')
+			sb.WriteString(strings.ToUpper(hex.EncodeToString([]byte{c})))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
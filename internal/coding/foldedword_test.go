@@ -0,0 +1,98 @@
+package coding
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func identity(s string) ([]byte, error) { return []byte(s), nil }
+
+func TestSplitEncodedWordsShort(t *testing.T) {
+	words, err := SplitEncodedWords("utf-8", "hello", identity, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 1 {
+		t.Fatalf("expected a single encoded-word, got %d: %v", len(words), words)
+	}
+}
+
+func TestSplitEncodedWordsLongSplits(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	words, err := SplitEncodedWords("utf-8", long, identity, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) < 2 {
+		t.Fatalf("expected long value to split into multiple encoded-words, got %d", len(words))
+	}
+	for _, w := range words {
+		if len(w) > maxEncodedWordLen {
+			t.Errorf("encoded-word exceeds %d chars: %q (%d)", maxEncodedWordLen, w, len(w))
+		}
+	}
+}
+
+func TestSplitEncodedWordsNeverSplitsRune(t *testing.T) {
+	long := strings.Repeat("あ", 60) // multibyte, would corrupt if split mid-rune
+	words, err := SplitEncodedWords("utf-8", long, identity, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rebuilt strings.Builder
+	for _, w := range words {
+		if len(w) > maxEncodedWordLen {
+			t.Errorf("encoded-word exceeds %d chars: %q (%d)", maxEncodedWordLen, w, len(w))
+		}
+		inner := strings.TrimSuffix(strings.TrimPrefix(w, "=?utf-8?B?"), "?=")
+		decoded, err := base64.StdEncoding.DecodeString(inner)
+		if err != nil {
+			t.Fatalf("encoded-word payload is not valid base64: %q: %v", inner, err)
+		}
+		rebuilt.Write(decoded)
+	}
+	// Each encoded-word's payload must itself be valid, complete base64 that
+	// decodes to whole UTF-8 runes (no partial rune leaked across a word
+	// boundary).
+	for _, w := range words {
+		inner := strings.TrimSuffix(strings.TrimPrefix(w, "=?utf-8?B?"), "?=")
+		if len(inner)%4 != 0 {
+			t.Errorf("encoded-word payload is not complete base64: %q", inner)
+		}
+		decoded, _ := base64.StdEncoding.DecodeString(inner)
+		if !utf8.Valid(decoded) {
+			t.Errorf("encoded-word payload splits a rune: %q", inner)
+		}
+	}
+	if rebuilt.String() != long {
+		t.Errorf("decoded encoded-words = %q, want %q", rebuilt.String(), long)
+	}
+}
+
+func TestFoldEncodedWordsJoinsWithCRLFSpace(t *testing.T) {
+	words := []string{"=?utf-8?B?AAAA?=", "=?utf-8?B?BBBB?="}
+	got := FoldEncodedWords(words, 9)
+	want := "=?utf-8?B?AAAA?=\r\n =?utf-8?B?BBBB?="
+	if got != want {
+		t.Errorf("FoldEncodedWords() = %q, want %q", got, want)
+	}
+}
+
+func TestFoldEncodedWordsFoldsBeforeFirstWordIfNeeded(t *testing.T) {
+	word := "=?utf-8?B?" + strings.Repeat("A", 60) + "?="
+	got := FoldEncodedWords([]string{word}, 70)
+	want := "\r\n " + word
+	if got != want {
+		t.Errorf("FoldEncodedWords() = %q, want %q", got, want)
+	}
+}
+
+func TestQEncode(t *testing.T) {
+	got := qEncode([]byte("a b_c"))
+	want := "a_b=5Fc"
+	if got != want {
+		t.Errorf("qEncode() = %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package stringutil
 import (
 	"bytes"
 	"net/mail"
+	"strings"
 )
 
 var crlf = []byte{13, 10}
@@ -43,11 +44,15 @@ func EncodeAwareJoinAddress(headerEncoder func(int, string) (int, string, error)
 			col += 1
 		}
 		if a.Name != "" {
-			col, encoded, err := headerEncoder(col, a.Name)
+			_, encoded, err := headerEncoder(col, a.Name)
 			if err != nil {
 				return "", err
 			}
 			_, _ = buf.WriteString(encoded)
+			// encoded may already contain CRLF+space folds inserted between RFC
+			// 2047 encoded-words, so the column to fold on next is the length of
+			// its last line, not the encoder's return value.
+			col = lastLineLen(encoded, col)
 			if col > 76 {
 				// fold
 				_, _ = buf.Write(crlf)
@@ -66,3 +71,14 @@ func EncodeAwareJoinAddress(headerEncoder func(int, string) (int, string, error)
 func StringizeAddress(headerEncoder func(int, string) (int, string, error), startColumn int, addr mail.Address) (string, error) {
 	return EncodeAwareJoinAddress(headerEncoder, startColumn, []mail.Address{addr})
 }
+
+// lastLineLen returns the column width of s's last line, where base is the
+// column s started at. If s contains no fold (CRLF), that's simply
+// base+len(s); if it does, a fold already happened and only the text after
+// the final CRLF counts.
+func lastLineLen(s string, base int) int {
+	if idx := strings.LastIndex(s, "\r\n"); idx >= 0 {
+		return len(s) - idx - 2
+	}
+	return base + len(s)
+}
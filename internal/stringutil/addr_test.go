@@ -0,0 +1,35 @@
+package stringutil
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// foldingHeaderEncoder simulates a HeaderEncoder that RFC 2047-encodes and
+// folds long values into multiple "=?utf-8?B?...?=" words joined by "\r\n ".
+func foldingHeaderEncoder(startColumn int, v string) (int, string, error) {
+	if len(v) <= 10 {
+		return startColumn + len(v), v, nil
+	}
+	words := []string{"=?utf-8?B?AAAAAAAAAA?=", "=?utf-8?B?BBBBBBBBBB?="}
+	joined := strings.Join(words, "\r\n ")
+	return startColumn + len(joined), joined, nil
+}
+
+func TestEncodeAwareJoinAddressDoesNotDoubleFoldEncodedWords(t *testing.T) {
+	addrs := []mail.Address{{Name: "A Very Long Display Name Indeed", Address: "a@example.com"}}
+	got, err := EncodeAwareJoinAddress(foldingHeaderEncoder, 0, addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The encoder's own "\r\n " fold must survive untouched; EncodeAwareJoinAddress must not
+	// insert a second fold immediately after it.
+	if strings.Contains(got, "\r\n \r\n") {
+		t.Errorf("EncodeAwareJoinAddress() double-folded: %q", got)
+	}
+	want := "=?utf-8?B?AAAAAAAAAA?=\r\n =?utf-8?B?BBBBBBBBBB?= <a@example.com>"
+	if got != want {
+		t.Errorf("EncodeAwareJoinAddress() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,26 @@
+package smime
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// Envelope CMS-encrypts data for the given recipients, producing a
+// DER-encoded PKCS#7 EnvelopedData structure suitable for base64 encoding
+// as an application/pkcs7-mime; smime-type=enveloped-data body.
+//
+// go.mozilla.org/pkcs7 only supports RSA recipients, so Envelope rejects any
+// certificate whose public key isn't *rsa.PublicKey up front rather than
+// letting pkcs7.Encrypt panic on an unchecked type assertion.
+func Envelope(data []byte, recipients []*x509.Certificate) ([]byte, error) {
+	for _, cert := range recipients {
+		if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("smime: recipient %q has a %T public key, only RSA is supported",
+				cert.Subject, cert.PublicKey)
+		}
+	}
+	return pkcs7.Encrypt(data, recipients)
+}
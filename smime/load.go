@@ -0,0 +1,110 @@
+package smime
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// LoadSignerFromPEM builds a Signer from a PEM-encoded certificate, a
+// PEM-encoded private key, and zero or more PEM files containing
+// intermediate or CA certificates to carry along in the signature.
+func LoadSignerFromPEM(certFile, keyFile string, caFiles ...string) (*Signer, error) {
+	cert, err := loadCertPEM(certFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadKeyPEM(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := LoadCA(caFiles...)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(cert, key, chain), nil
+}
+
+// LoadSignerFromPKCS12 builds a Signer from a PKCS#12 (.p12/.pfx) bundle
+// containing the signing certificate, private key, and any CA certificates.
+func LoadSignerFromPKCS12(p12File, password string) (*Signer, error) {
+	data, err := os.ReadFile(p12File)
+	if err != nil {
+		return nil, err
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("smime: private key does not implement crypto.Signer")
+	}
+	return NewSigner(cert, signer, chain), nil
+}
+
+// LoadCA reads one or more PEM files, each of which may contain multiple
+// certificates, and returns the concatenated list. It is intended for
+// loading an S/MIME CA chain to accompany a signer, or a set of recipient
+// certificates for enveloping.
+func LoadCA(files ...string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+func loadCertPEM(file string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("smime: no PEM certificate found in " + file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func loadKeyPEM(file string) (crypto.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("smime: no PEM key found in " + file)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("smime: key does not implement crypto.Signer")
+	}
+	return signer, nil
+}
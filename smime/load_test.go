@@ -0,0 +1,162 @@
+package smime_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jhillyerd/enmime/smime"
+	"go.mozilla.org/pkcs7"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func writePEMFile(t *testing.T, dir, name, blockType string, bytes []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSignerFromPEM(t *testing.T) {
+	cert, key := genRSAForLoadTest(t)
+	caCert, _ := genRSAForLoadTest(t)
+	dir := t.TempDir()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEMFile(t, dir, "cert.pem", "CERTIFICATE", cert.Raw)
+	keyFile := writePEMFile(t, dir, "key.pem", "PRIVATE KEY", keyDER)
+	caFile := writePEMFile(t, dir, "ca.pem", "CERTIFICATE", caCert.Raw)
+
+	signer, err := smime.LoadSignerFromPEM(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte("This is the message body.\r\n")
+	sig, err := signer.Sign(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7.Content = body
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+}
+
+func TestLoadSignerFromPKCS12(t *testing.T) {
+	cert, key := genRSAForLoadTest(t)
+	dir := t.TempDir()
+
+	pfxData, err := pkcs12.Encode(rand.Reader, key, cert, nil, "p12pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12File := filepath.Join(dir, "bundle.p12")
+	if err := os.WriteFile(p12File, pfxData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := smime.LoadSignerFromPKCS12(p12File, "p12pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := []byte("This is the message body.\r\n")
+	sig, err := signer.Sign(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7.Content = body
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	certA, _ := genRSAForLoadTest(t)
+	certB, _ := genRSAForLoadTest(t)
+	dir := t.TempDir()
+
+	// One file holding two concatenated certificates, plus a second file
+	// holding a third, to exercise both the multi-cert-per-file and
+	// multi-file cases.
+	certC, _ := genRSAForLoadTest(t)
+	combinedFile := filepath.Join(dir, "combined.pem")
+	combined := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certA.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certB.Raw})...,
+	)
+	if err := os.WriteFile(combinedFile, combined, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	soloFile := writePEMFile(t, dir, "solo.pem", "CERTIFICATE", certC.Raw)
+
+	certs, err := smime.LoadCA(combinedFile, soloFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 3 {
+		t.Fatalf("LoadCA() returned %d certs, want 3", len(certs))
+	}
+	wantSerials := map[string]bool{
+		certA.SerialNumber.String(): true,
+		certB.SerialNumber.String(): true,
+		certC.SerialNumber.String(): true,
+	}
+	for _, c := range certs {
+		if !wantSerials[c.SerialNumber.String()] {
+			t.Errorf("LoadCA() returned unexpected cert with serial %s", c.SerialNumber)
+		}
+	}
+}
+
+// genRSAForLoadTest builds a throwaway self-signed RSA certificate for the
+// load.go round-trip tests.
+func genRSAForLoadTest(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "enmime test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,44 @@
+// Package smime provides S/MIME signing and encryption primitives used by
+// enmime's Encoder to produce multipart/signed and application/pkcs7-mime
+// messages.
+package smime
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// Signer holds the certificate, private key, and optional CA chain used to
+// produce a detached PKCS#7 SignedData signature over a message body.
+type Signer struct {
+	cert  *x509.Certificate
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+// NewSigner builds a Signer from an already-parsed certificate, private key,
+// and optional intermediate/CA chain to include in the signature.
+func NewSigner(cert *x509.Certificate, key crypto.Signer, chain []*x509.Certificate) *Signer {
+	return &Signer{cert: cert, key: key, chain: chain}
+}
+
+// Sign produces a DER-encoded, detached PKCS#7 SignedData signature over
+// data. The returned bytes are suitable for base64 encoding as the second
+// body part of a multipart/signed message.
+func (s *Signer) Sign(data []byte) ([]byte, error) {
+	sd, err := pkcs7.NewSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSigner(s.cert, s.key, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	for _, c := range s.chain {
+		sd.AddCertificate(c)
+	}
+	sd.Detach()
+	return sd.Finish()
+}
@@ -0,0 +1,118 @@
+package smime_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jhillyerd/enmime/smime"
+	"go.mozilla.org/pkcs7"
+)
+
+func genSelfSigned(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "enmime test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// genSelfSignedRSA is the RSA equivalent of genSelfSigned. go.mozilla.org/pkcs7
+// only supports RSA recipients for enveloping, so envelope tests need a key
+// distinct from the ECDSA one genSelfSigned produces for signing tests.
+func genSelfSignedRSA(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "enmime test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestSignerSignVerifies(t *testing.T) {
+	cert, key := genSelfSigned(t)
+	signer := smime.NewSigner(cert, key, nil)
+
+	body := []byte("This is the message body.\r\n")
+	sig, err := signer.Sign(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p7, err := pkcs7.Parse(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7.Content = body
+	if err := p7.Verify(); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	cert, key := genSelfSignedRSA(t)
+
+	body := []byte("Secret message.\r\n")
+	enveloped, err := smime.Envelope(body, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p7, err := pkcs7.Parse(enveloped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := p7.Decrypt(cert, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != string(body) {
+		t.Fatalf("decrypted content mismatch: got %q want %q", decrypted, body)
+	}
+}
+
+func TestEnvelopeRejectsNonRSARecipient(t *testing.T) {
+	cert, _ := genSelfSigned(t)
+
+	_, err := smime.Envelope([]byte("Secret message.\r\n"), []*x509.Certificate{cert})
+	if err == nil {
+		t.Fatal("expected an error for a non-RSA recipient certificate, got nil")
+	}
+}